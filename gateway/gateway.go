@@ -0,0 +1,850 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+
+	"github.com/rudderlabs/rudder-server/config"
+	backendconfig "github.com/rudderlabs/rudder-server/config/backend-config"
+	"github.com/rudderlabs/rudder-server/jobsdb"
+	"github.com/rudderlabs/rudder-server/services/stats"
+	"github.com/rudderlabs/rudder-server/utils"
+	"github.com/rudderlabs/rudder-server/utils/misc"
+)
+
+// CustomVal is used as the customVal column for every job the gateway writes.
+const CustomVal = "GW"
+
+// Response body constants returned by the web handlers.
+const (
+	Ok                    = "OK"
+	RequestBodyNil        = "Request body is nil"
+	RequestBodyReadFailed = "Failed to read request body"
+	RequestBodyTooLarge   = "Request size exceeds max limit"
+	InvalidWriteKey       = "Invalid Write Key"
+	InvalidJSON           = "Invalid JSON"
+	NoWriteKeyInBasicAuth = "No write key supplied in Basic Auth"
+	TooManyRequests       = "Max Requests Limit reached"
+	// RequestTimedOut is returned both when a ?wait=true request's
+	// AwaitResponse call times out (504) and when a web*Handler itself runs
+	// past the configured HandlerTimeout (503).
+	RequestTimedOut   = "Request timed out waiting for downstream response"
+	MaxWaitersReached = "Max in-flight sync requests reached, try again later"
+	// SyncResponseUnsupportedMultiNode is returned for a ?wait=true request
+	// when the gateway is configured as part of a multi-node deployment: see
+	// AwaitResponse for why synchronous responses can't be honored there.
+	SyncResponseUnsupportedMultiNode = "Synchronous responses are not supported in multi-node deployments"
+)
+
+// errMaxWaitersReached and errResponseTimeout are returned by AwaitResponse;
+// they are unexported because callers only need to distinguish "try later"
+// (503) from "gave up waiting" (504), which webHandler does by identity.
+var (
+	errMaxWaitersReached = errors.New("gateway: max in-flight sync waiters reached")
+	errResponseTimeout   = errors.New("gateway: timed out waiting for downstream response")
+)
+
+// Response is the status/body/headers envelope the gateway hands back to a
+// client that opted into synchronous (?wait=true) delivery, once the
+// processor/router has produced a terminal outcome for that message.
+type Response struct {
+	StatusCode int
+	Body       string
+	Headers    map[string]string
+}
+
+// batchItemResult records one batch[] element's own outcome, so a client can
+// tell which messages in a partially-accepted batch actually landed.
+type batchItemResult struct {
+	Index     int    `json:"index"`
+	MessageID string `json:"messageId,omitempty"`
+	Status    int    `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+// batchResponse is the JSON body webBatchHandler returns: Results carries one
+// batchItemResult per batch[] element, in order, and Accepted/Rejected tally
+// how many landed versus were rejected. The overall HTTP status is 200 if
+// Accepted > 0, 400 if every element was rejected; a caller that needs to
+// know about a partial failure must inspect Results itself.
+type batchResponse struct {
+	Results  []batchItemResult `json:"results"`
+	Accepted int               `json:"accepted"`
+	Rejected int               `json:"rejected"`
+}
+
+// RateLimiter is the interface a gateway rate-limiting backend must satisfy.
+// It is deliberately narrow so that the in-process token bucket implementation
+// under services/rate-limiter can be swapped for a distributed one (e.g.
+// Redis-backed, for multi-node deployments) later on. RetryAfter reports how
+// long a caller should wait before the bucket identified by key next has
+// capacity; it is only meaningful immediately after LimitReached(key) is true.
+type RateLimiter interface {
+	LimitReached(key string) bool
+	RetryAfter(key string) time.Duration
+}
+
+// rate limit bucket key prefixes, so that a writeKey, sourceID and
+// workspaceID that happen to share a string value never collide.
+const (
+	rateLimitKeyWriteKey  = "writeKey:"
+	rateLimitKeySource    = "source:"
+	rateLimitKeyWorkspace = "workspace:"
+)
+
+// rateLimitLayer is one entry in the most-specific-to-least-specific policy
+// chain evaluated by checkRateLimits. key is what's passed to the RateLimiter
+// (prefixed, to keep buckets from different layers from colliding); label is
+// the raw ID (writeKey/sourceID/workspaceID) used when naming stats.
+type rateLimitLayer struct {
+	key      string
+	label    string
+	statName string
+}
+
+// RespondingTimeouts bounds how long the gateway's http.Server will wait at
+// each stage of a request/response cycle, plus how long a single web*Handler
+// invocation is allowed to run before it's aborted with a 503.
+type RespondingTimeouts struct {
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	HandlerTimeout    time.Duration
+}
+
+var (
+	enableRateLimit bool
+	enableDedup     bool
+
+	maxReqSize                 int
+	maxUserWebRequestBatchSize int
+	batchTimeout               time.Duration
+
+	syncResponseTimeout    time.Duration
+	maxInFlightSyncWaiters int
+	multiNodeDeployment    bool
+
+	respondingTimeouts RespondingTimeouts
+)
+
+func loadConfig() {
+	maxReqSize = config.GetInt("Gateway.maxReqSizeInKB", 4000) * 1000
+	maxUserWebRequestBatchSize = config.GetInt("Gateway.maxUserWebRequestBatchSize", 128)
+	batchTimeout = config.GetDuration("Gateway.batchTimeoutInMS", 20) * time.Millisecond
+
+	syncResponseTimeout = config.GetDuration("Gateway.syncResponseTimeoutInS", 10) * time.Second
+	maxInFlightSyncWaiters = config.GetInt("Gateway.maxInFlightSyncWaiters", 10000)
+	multiNodeDeployment = config.GetBool("Gateway.multiNodeDeployment", false)
+
+	respondingTimeouts = RespondingTimeouts{
+		ReadTimeout:       config.GetDuration("Gateway.readTimeoutInS", 10) * time.Second,
+		ReadHeaderTimeout: config.GetDuration("Gateway.readHeaderTimeoutInS", 3) * time.Second,
+		WriteTimeout:      config.GetDuration("Gateway.writeTimeoutInS", 10) * time.Second,
+		IdleTimeout:       config.GetDuration("Gateway.idleTimeoutInS", 30) * time.Second,
+		HandlerTimeout:    config.GetDuration("Gateway.handlerTimeoutInS", 20) * time.Second,
+	}
+}
+
+// SetEnableRateLimit overrides whether gateway rate limiting is enforced.
+// Exposed so tests can toggle it without reaching into config.
+func SetEnableRateLimit(value bool) {
+	enableRateLimit = value
+}
+
+// SetEnableDedup overrides whether gateway level message deduplication is enforced.
+// Exposed so tests can toggle it without reaching into config.
+func SetEnableDedup(value bool) {
+	enableDedup = value
+}
+
+// SetSyncResponseTimeout overrides how long a ?wait=true request blocks for a
+// downstream response before failing with RequestTimedOut. Exposed so tests
+// don't have to wait out the real configured timeout.
+func SetSyncResponseTimeout(timeout time.Duration) {
+	syncResponseTimeout = timeout
+}
+
+// SetHandlerTimeout overrides how long a single web*Handler invocation may
+// run before it is aborted with a 503 RequestTimedOut. Exposed so tests don't
+// have to wait out the real configured timeout.
+func SetHandlerTimeout(timeout time.Duration) {
+	respondingTimeouts.HandlerTimeout = timeout
+}
+
+// SetMultiNodeDeployment overrides whether the gateway is configured as part
+// of a multi-node deployment, which disables ?wait=true support (see
+// AwaitResponse). Exposed so tests can toggle it without reaching into
+// config.
+func SetMultiNodeDeployment(value bool) {
+	multiNodeDeployment = value
+}
+
+// SetMaxInFlightSyncWaiters overrides how many ?wait=true requests may be
+// registered in AwaitResponse at once before new ones are rejected with
+// errMaxWaitersReached. Exposed so tests can drive the limit without waiting
+// out the real configured value.
+func SetMaxInFlightSyncWaiters(value int) {
+	maxInFlightSyncWaiters = value
+}
+
+func init() {
+	loadConfig()
+}
+
+// webRequestT is the unit of work queued by a web*Handler and consumed by the
+// goroutine that actually talks to JobsDB.
+type webRequestT struct {
+	done           chan string
+	reqType        string
+	request        *http.Request
+	writeKey       string
+	sourceID       string
+	requestPayload []byte
+	messageID      string
+	// authFailed carries a pre-computed error for requests (e.g. rate-limited
+	// ones) that must still flow through the batch so that batch size/time
+	// stats stay accurate, but never produce a job.
+	authFailed string
+}
+
+// batchWebRequestT groups together the webRequestT instances that will be
+// flushed to JobsDB in a single Store call.
+type batchWebRequestT struct {
+	batchRequest []*webRequestT
+}
+
+// HandleT is the handle to this module.
+type HandleT struct {
+	webRequestQ   chan *webRequestT
+	batchRequestQ chan *batchWebRequestT
+
+	jobsDB        jobsdb.JobsDB
+	backendConfig backendconfig.BackendConfig
+	rateLimiter   RateLimiter
+	statsHandle   stats.Stats
+
+	batchSizeStat    stats.RudderStats
+	batchTimeStat    stats.RudderStats
+	responseTimeStat stats.RudderStats
+
+	configSubscriberLock sync.RWMutex
+	writeKeyEnabledMap   map[string]bool
+	writeKeySourceIDMap  map[string]string
+
+	// waitersMu/waiters back AwaitResponse/PublishResponse, the synchronous
+	// request-reply extension: a client that opted in via ?wait=true blocks
+	// on a channel registered here, keyed by the message's correlation ID
+	// (its messageId), until the processor/router delivers a terminal
+	// outcome for that specific message.
+	waitersMu sync.Mutex
+	waiters   map[string]chan Response
+
+	clearDB *bool
+}
+
+// Setup initializes this module: it wires up its dependencies (backend
+// config, jobsDB, rate limiter and stats) and starts the background
+// goroutines that batch incoming requests into JobsDB writes.
+func (gateway *HandleT) Setup(backendConfig backendconfig.BackendConfig, jobsDB jobsdb.JobsDB, rateLimiter RateLimiter, statsHandle stats.Stats, clearDB *bool) {
+	gateway.backendConfig = backendConfig
+	gateway.jobsDB = jobsDB
+	gateway.rateLimiter = rateLimiter
+	gateway.statsHandle = statsHandle
+	gateway.clearDB = clearDB
+
+	gateway.responseTimeStat = gateway.statsHandle.NewStat("gateway.response_time", stats.TimerType)
+	gateway.batchSizeStat = gateway.statsHandle.NewStat("gateway.batch_size", stats.CountType)
+	gateway.batchTimeStat = gateway.statsHandle.NewStat("gateway.batch_time", stats.TimerType)
+
+	gateway.webRequestQ = make(chan *webRequestT)
+	gateway.batchRequestQ = make(chan *batchWebRequestT)
+	gateway.waiters = make(map[string]chan Response)
+
+	gateway.backendConfig.WaitForConfig()
+	go gateway.backendConfigSubscriber()
+
+	go gateway.webRequestBatcher()
+	go gateway.dbWriterWorkerProcess()
+}
+
+// backendConfigSubscriber keeps writeKeyEnabledMap / writeKeySourceIDMap in
+// sync with the latest backend configuration.
+func (gateway *HandleT) backendConfigSubscriber() {
+	ch := make(chan utils.DataEvent)
+	gateway.backendConfig.Subscribe(ch, backendconfig.TopicProcessConfig)
+	for event := range ch {
+		sources := event.Data.(backendconfig.SourcesT)
+
+		writeKeyEnabledMap := make(map[string]bool)
+		writeKeySourceIDMap := make(map[string]string)
+		for _, source := range sources.Sources {
+			writeKeyEnabledMap[source.WriteKey] = source.Enabled
+			writeKeySourceIDMap[source.WriteKey] = source.ID
+		}
+
+		gateway.configSubscriberLock.Lock()
+		gateway.writeKeyEnabledMap = writeKeyEnabledMap
+		gateway.writeKeySourceIDMap = writeKeySourceIDMap
+		gateway.configSubscriberLock.Unlock()
+	}
+}
+
+func (gateway *HandleT) getSourceIDForWriteKey(writeKey string) string {
+	gateway.configSubscriberLock.RLock()
+	defer gateway.configSubscriberLock.RUnlock()
+	return gateway.writeKeySourceIDMap[writeKey]
+}
+
+func (gateway *HandleT) isWriteKeyEnabled(writeKey string) bool {
+	gateway.configSubscriberLock.RLock()
+	defer gateway.configSubscriberLock.RUnlock()
+	return gateway.writeKeyEnabledMap[writeKey]
+}
+
+// MaxReqSize returns the configured maximum accepted request body size, in bytes.
+func (gateway *HandleT) MaxReqSize() int {
+	return maxReqSize
+}
+
+func (gateway *HandleT) incrementWriteKeyStat(name string, writeKey string, count int) {
+	gateway.statsHandle.NewWriteKeyStat(name, stats.CountType, writeKey).Count(count)
+}
+
+// AwaitResponse registers messageID as awaiting a terminal outcome and blocks
+// until PublishResponse delivers one, timeout elapses, or the number of
+// in-flight waiters on this node is already at maxInFlightSyncWaiters (in
+// which case it returns immediately with errMaxWaitersReached).
+//
+// waiters and PublishResponse are both in-process and per-node: a message
+// processed by a node other than the one its ?wait=true request landed on
+// would never reach this node's waiters map. Rather than block such a
+// request out for the full timeout only to 504, webHandler refuses
+// ?wait=true up front with SyncResponseUnsupportedMultiNode whenever
+// multiNodeDeployment is set, so AwaitResponse itself is only ever reached
+// on a single-node deployment, where every PublishResponse is guaranteed to
+// be local.
+func (gateway *HandleT) AwaitResponse(messageID string, timeout time.Duration) (Response, error) {
+	gateway.waitersMu.Lock()
+	if len(gateway.waiters) >= maxInFlightSyncWaiters {
+		gateway.waitersMu.Unlock()
+		return Response{}, errMaxWaitersReached
+	}
+	ch := make(chan Response, 1)
+	gateway.waiters[messageID] = ch
+	gateway.waitersMu.Unlock()
+
+	defer func() {
+		gateway.waitersMu.Lock()
+		delete(gateway.waiters, messageID)
+		gateway.waitersMu.Unlock()
+	}()
+
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-time.After(timeout):
+		return Response{}, errResponseTimeout
+	}
+}
+
+// PublishResponse delivers resp to the waiter registered for messageID, if
+// any is currently registered on this node. The processor/router calls this
+// once a job reaches a terminal outcome (success, failure or drop). It
+// returns false if no local waiter was found, which the caller should treat
+// as "nothing to do" rather than an error.
+func (gateway *HandleT) PublishResponse(messageID string, resp Response) bool {
+	gateway.waitersMu.Lock()
+	ch, ok := gateway.waiters[messageID]
+	gateway.waitersMu.Unlock()
+	if !ok {
+		return false
+	}
+	select {
+	case ch <- resp:
+		return true
+	default:
+		return false
+	}
+}
+
+// webRequestBatcher accumulates webRequestT instances and flushes them,
+// either once maxUserWebRequestBatchSize is reached or batchTimeout elapses,
+// whichever happens first.
+func (gateway *HandleT) webRequestBatcher() {
+	reqBuffer := make([]*webRequestT, 0)
+	timeout := time.After(batchTimeout)
+	for {
+		select {
+		case req := <-gateway.webRequestQ:
+			reqBuffer = append(reqBuffer, req)
+			if len(reqBuffer) >= maxUserWebRequestBatchSize {
+				gateway.batchRequestQ <- &batchWebRequestT{batchRequest: reqBuffer}
+				reqBuffer = make([]*webRequestT, 0)
+			}
+		case <-timeout:
+			timeout = time.After(batchTimeout)
+			if len(reqBuffer) > 0 {
+				gateway.batchRequestQ <- &batchWebRequestT{batchRequest: reqBuffer}
+				reqBuffer = make([]*webRequestT, 0)
+			}
+		}
+	}
+}
+
+// dbWriterWorkerProcess consumes flushed batches and performs the single
+// JobsDB.Store call for each of them.
+func (gateway *HandleT) dbWriterWorkerProcess() {
+	for breq := range gateway.batchRequestQ {
+		gateway.processWebRequestBatch(breq)
+	}
+}
+
+func (gateway *HandleT) processWebRequestBatch(breq *batchWebRequestT) {
+	gateway.batchTimeStat.Start()
+
+	var jobList []*jobsdb.JobT
+	jobForReq := make(map[*webRequestT]*jobsdb.JobT)
+
+	for _, req := range breq.batchRequest {
+		if req.authFailed != "" {
+			continue
+		}
+
+		parameters, _ := json.Marshal(struct {
+			SourceID  string `json:"source_id"`
+			MessageID string `json:"messageId"`
+		}{SourceID: req.sourceID, MessageID: req.messageID})
+
+		job := &jobsdb.JobT{
+			UUID:         uuid.NewV4(),
+			Parameters:   json.RawMessage(parameters),
+			CustomVal:    CustomVal,
+			EventPayload: json.RawMessage(req.requestPayload),
+		}
+		jobList = append(jobList, job)
+		jobForReq[req] = job
+	}
+
+	errorMessagesMap := gateway.jobsDB.Store(jobList)
+
+	gateway.batchTimeStat.End()
+	gateway.batchSizeStat.Count(len(breq.batchRequest))
+
+	for _, req := range breq.batchRequest {
+		if req.authFailed != "" {
+			req.done <- req.authFailed
+			continue
+		}
+		job := jobForReq[req]
+		req.done <- errorMessagesMap[job.UUID]
+	}
+}
+
+// buildPayload wraps the raw request body with the metadata the downstream
+// pipeline (processor/router) relies on: receivedAt, writeKey, requestIP and a
+// "batch" array of exactly one message carrying messageId/anonymousId/type.
+func buildPayload(reqType, writeKey string, body []byte, r *http.Request) ([]byte, string) {
+	messageID := uuid.NewV4().String()
+	anonymousID := uuid.NewV4().String()
+
+	message, _ := sjson.SetBytes(body, "messageId", messageID)
+	message, _ = sjson.SetBytes(message, "anonymousId", anonymousID)
+	message, _ = sjson.SetBytes(message, "type", reqType)
+
+	payload, _ := sjson.SetRawBytes([]byte(`{}`), "batch.0", message)
+	payload, _ = sjson.SetBytes(payload, "receivedAt", time.Now().Format(misc.RFC3339Milli))
+	payload, _ = sjson.SetBytes(payload, "writeKey", writeKey)
+	payload, _ = sjson.SetBytes(payload, "requestIP", r.RemoteAddr)
+
+	return payload, messageID
+}
+
+// buildBatchItemPayload wraps a single already-parsed batch[] element with
+// the same request-level metadata buildPayload adds for single-message
+// handlers (receivedAt, writeKey, requestIP). Unlike buildPayload, it leaves
+// the item's own "type" untouched and only assigns messageId/anonymousId if
+// the item didn't already carry them, since batch items commonly arrive with
+// both already set.
+func buildBatchItemPayload(item []byte, writeKey string, r *http.Request) ([]byte, string) {
+	message := item
+
+	messageID := gjson.GetBytes(message, "messageId").String()
+	if messageID == "" {
+		messageID = uuid.NewV4().String()
+		message, _ = sjson.SetBytes(message, "messageId", messageID)
+	}
+	if !gjson.GetBytes(message, "anonymousId").Exists() {
+		message, _ = sjson.SetBytes(message, "anonymousId", uuid.NewV4().String())
+	}
+
+	payload, _ := sjson.SetRawBytes([]byte(`{}`), "batch.0", message)
+	payload, _ = sjson.SetBytes(payload, "receivedAt", time.Now().Format(misc.RFC3339Milli))
+	payload, _ = sjson.SetBytes(payload, "writeKey", writeKey)
+	payload, _ = sjson.SetBytes(payload, "requestIP", r.RemoteAddr)
+
+	return payload, messageID
+}
+
+// rejectRequest still pushes a bookkeeping-only request through the batching
+// pipeline, so that batch size/time stats and the (possibly empty) Store call
+// stay accurate, even though a rejected request never produces a job.
+func (gateway *HandleT) rejectRequest(reqType string, w http.ResponseWriter, message string) {
+	gateway.rejectRequestWithStatus(reqType, w, message, http.StatusBadRequest)
+}
+
+func (gateway *HandleT) rejectRequestWithStatus(reqType string, w http.ResponseWriter, message string, statusCode int) {
+	req := &webRequestT{reqType: reqType, authFailed: message, done: make(chan string)}
+	gateway.webRequestQ <- req
+	<-req.done
+	http.Error(w, message, statusCode)
+}
+
+// checkRateLimits evaluates the writeKey, source and workspace buckets, in
+// that most-specific-to-least-specific order, stopping at the first one that
+// has tripped. Returns ok=false if every layer has capacity.
+func (gateway *HandleT) checkRateLimits(writeKey, sourceID, workspaceID string) (layer rateLimitLayer, tripped bool) {
+	layers := []rateLimitLayer{
+		{key: rateLimitKeyWriteKey + writeKey, label: writeKey, statName: "gateway.write_key_dropped_requests"},
+		{key: rateLimitKeySource + sourceID, label: sourceID, statName: "gateway.source_dropped_requests"},
+		{key: rateLimitKeyWorkspace + workspaceID, label: workspaceID, statName: "gateway.work_space_dropped_requests"},
+	}
+	for _, l := range layers {
+		if gateway.rateLimiter.LimitReached(l.key) {
+			return l, true
+		}
+	}
+	return rateLimitLayer{}, false
+}
+
+// enforceRateLimits is the shared enableRateLimit gate for every web*Handler:
+// it looks up writeKey's workspace, runs checkRateLimits, and on a tripped
+// layer emits that layer's dropped-request stat, sets Retry-After and rejects
+// the request with 429. Returns ok=false if the caller must return without
+// doing anything further.
+func (gateway *HandleT) enforceRateLimits(reqType string, w http.ResponseWriter, writeKey, sourceID string) (ok bool) {
+	if !enableRateLimit {
+		return true
+	}
+
+	workspaceID := gateway.backendConfig.GetWorkspaceIDForWriteKey(writeKey)
+	layer, tripped := gateway.checkRateLimits(writeKey, sourceID, workspaceID)
+	if !tripped {
+		return true
+	}
+
+	gateway.incrementWriteKeyStat(layer.statName, layer.label, 1)
+	retryAfter := gateway.rateLimiter.RetryAfter(layer.key)
+	w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(retryAfter.Seconds())), 10))
+	gateway.rejectRequestWithStatus(reqType, w, TooManyRequests, http.StatusTooManyRequests)
+	return false
+}
+
+// authorizeAndReadBody performs the checks common to every web*Handler —
+// Basic Auth, presence/size/validity of the request body, and whether
+// writeKey is known and enabled — rejecting the request itself (and
+// recording the usual write_key_* stats) on the caller's behalf. ok is false
+// if any check failed, in which case the caller must return without doing
+// anything further.
+func (gateway *HandleT) authorizeAndReadBody(reqType string, w http.ResponseWriter, r *http.Request) (writeKey, sourceID string, body []byte, ok bool) {
+	var authOK bool
+	writeKey, _, authOK = r.BasicAuth()
+	gateway.incrementWriteKeyStat("gateway.write_key_requests", writeKey, 1)
+
+	if !authOK || writeKey == "" {
+		gateway.incrementWriteKeyStat("gateway.write_key_failed_requests", "noWriteKey", 1)
+		gateway.rejectRequest(reqType, w, NoWriteKeyInBasicAuth)
+		return "", "", nil, false
+	}
+
+	if r.Body == nil {
+		gateway.rejectRequest(reqType, w, RequestBodyNil)
+		return "", "", nil, false
+	}
+	defer r.Body.Close()
+
+	var err error
+	body, err = ioutil.ReadAll(r.Body)
+	if err != nil {
+		gateway.incrementWriteKeyStat("gateway.write_key_failed_requests", writeKey, 1)
+		gateway.rejectRequest(reqType, w, RequestBodyReadFailed)
+		return "", "", nil, false
+	}
+
+	if !gjson.ValidBytes(body) {
+		gateway.incrementWriteKeyStat("gateway.write_key_failed_requests", writeKey, 1)
+		gateway.rejectRequest(reqType, w, InvalidJSON)
+		return "", "", nil, false
+	}
+
+	if len(body) > maxReqSize {
+		gateway.incrementWriteKeyStat("gateway.write_key_failed_requests", writeKey, 1)
+		gateway.incrementWriteKeyStat("gateway.write_key_events", writeKey, 0)
+		gateway.incrementWriteKeyStat("gateway.write_key_failed_events", writeKey, 0)
+		gateway.rejectRequest(reqType, w, RequestBodyTooLarge)
+		return "", "", nil, false
+	}
+
+	if !gateway.isWriteKeyEnabled(writeKey) {
+		gateway.incrementWriteKeyStat("gateway.write_key_failed_requests", writeKey, 1)
+		gateway.incrementWriteKeyStat("gateway.write_key_events", writeKey, 0)
+		gateway.incrementWriteKeyStat("gateway.write_key_failed_events", writeKey, 0)
+		gateway.rejectRequest(reqType, w, InvalidWriteKey)
+		return "", "", nil, false
+	}
+
+	return writeKey, gateway.getSourceIDForWriteKey(writeKey), body, true
+}
+
+func (gateway *HandleT) webHandler(reqType string, w http.ResponseWriter, r *http.Request) {
+	gateway.responseTimeStat.Start()
+	defer gateway.responseTimeStat.End()
+
+	writeKey, sourceID, body, ok := gateway.authorizeAndReadBody(reqType, w, r)
+	if !ok {
+		return
+	}
+
+	if !gateway.enforceRateLimits(reqType, w, writeKey, sourceID) {
+		return
+	}
+
+	wait := r.URL.Query().Get("wait") == "true"
+	if wait && multiNodeDeployment {
+		http.Error(w, SyncResponseUnsupportedMultiNode, http.StatusNotImplemented)
+		return
+	}
+
+	payload, messageID := buildPayload(reqType, writeKey, body, r)
+
+	done := make(chan string)
+	req := &webRequestT{
+		done:           done,
+		reqType:        reqType,
+		request:        r,
+		writeKey:       writeKey,
+		sourceID:       sourceID,
+		requestPayload: payload,
+		messageID:      messageID,
+	}
+	gateway.webRequestQ <- req
+	errorMessage := <-done
+
+	gateway.incrementWriteKeyStat("gateway.write_key_events", writeKey, 0)
+	if errorMessage != "" {
+		gateway.incrementWriteKeyStat("gateway.write_key_failed_requests", writeKey, 1)
+		gateway.incrementWriteKeyStat("gateway.write_key_failed_events", writeKey, 0)
+		http.Error(w, errorMessage, http.StatusInternalServerError)
+		return
+	}
+
+	gateway.incrementWriteKeyStat("gateway.write_key_successful_requests", writeKey, 1)
+	gateway.incrementWriteKeyStat("gateway.write_key_successful_events", writeKey, 0)
+
+	if wait {
+		gateway.respondSync(w, messageID)
+		return
+	}
+	w.Write([]byte(Ok))
+}
+
+// respondSync blocks until the processor/router reports a terminal outcome
+// for messageID (via PublishResponse) and writes that outcome's status code,
+// headers and body as the HTTP response, instead of the usual bare 200 OK.
+func (gateway *HandleT) respondSync(w http.ResponseWriter, messageID string) {
+	resp, err := gateway.AwaitResponse(messageID, syncResponseTimeout)
+	if err != nil {
+		if err == errMaxWaitersReached {
+			http.Error(w, MaxWaitersReached, http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, RequestTimedOut, http.StatusGatewayTimeout)
+		return
+	}
+
+	for key, value := range resp.Headers {
+		w.Header().Set(key, value)
+	}
+	w.WriteHeader(resp.StatusCode)
+	w.Write([]byte(resp.Body))
+}
+
+func (gateway *HandleT) webAliasHandler(w http.ResponseWriter, r *http.Request) {
+	gateway.withHandlerTimeout("alias", gateway.webHandler)(w, r)
+}
+func (gateway *HandleT) webGroupHandler(w http.ResponseWriter, r *http.Request) {
+	gateway.withHandlerTimeout("group", gateway.webHandler)(w, r)
+}
+func (gateway *HandleT) webIdentifyHandler(w http.ResponseWriter, r *http.Request) {
+	gateway.withHandlerTimeout("identify", gateway.webHandler)(w, r)
+}
+func (gateway *HandleT) webPageHandler(w http.ResponseWriter, r *http.Request) {
+	gateway.withHandlerTimeout("page", gateway.webHandler)(w, r)
+}
+func (gateway *HandleT) webScreenHandler(w http.ResponseWriter, r *http.Request) {
+	gateway.withHandlerTimeout("screen", gateway.webHandler)(w, r)
+}
+func (gateway *HandleT) webTrackHandler(w http.ResponseWriter, r *http.Request) {
+	gateway.withHandlerTimeout("track", gateway.webHandler)(w, r)
+}
+
+// webBatchHandler validates and stores each batch[] element independently:
+// one invalid or failed message doesn't sink the rest. See
+// webBatchRequestHandler for the per-message processing and batchResponse
+// for the response format.
+func (gateway *HandleT) webBatchHandler(w http.ResponseWriter, r *http.Request) {
+	gateway.withHandlerTimeout("batch", gateway.webBatchRequestHandler)(w, r)
+}
+
+// webBatchRequestHandler is webBatchHandler's implementation. After the usual
+// auth/body/rate-limit checks, each batch[] element is validated and queued
+// independently: a malformed element is marked rejected without ever
+// reaching JobsDB, while well-formed ones are stored exactly like a
+// single-message handler's request, each keeping its own messageId. The
+// response reports every element's own outcome instead of a single bare
+// 200/400.
+func (gateway *HandleT) webBatchRequestHandler(reqType string, w http.ResponseWriter, r *http.Request) {
+	gateway.responseTimeStat.Start()
+	defer gateway.responseTimeStat.End()
+
+	writeKey, sourceID, body, ok := gateway.authorizeAndReadBody(reqType, w, r)
+	if !ok {
+		return
+	}
+
+	if !gateway.enforceRateLimits(reqType, w, writeKey, sourceID) {
+		return
+	}
+
+	items := gjson.GetBytes(body, "batch").Array()
+	results := make([]batchItemResult, len(items))
+	reqs := make([]*webRequestT, len(items))
+
+	for i, item := range items {
+		if !item.IsObject() {
+			results[i] = batchItemResult{Index: i, Status: http.StatusBadRequest, Error: InvalidJSON}
+			reqs[i] = &webRequestT{reqType: reqType, authFailed: InvalidJSON, done: make(chan string)}
+			continue
+		}
+
+		payload, messageID := buildBatchItemPayload([]byte(item.Raw), writeKey, r)
+		results[i] = batchItemResult{Index: i, MessageID: messageID}
+		reqs[i] = &webRequestT{
+			done:           make(chan string),
+			reqType:        reqType,
+			request:        r,
+			writeKey:       writeKey,
+			sourceID:       sourceID,
+			requestPayload: payload,
+			messageID:      messageID,
+		}
+	}
+
+	for _, req := range reqs {
+		gateway.webRequestQ <- req
+	}
+
+	var accepted, rejected int
+	for i, req := range reqs {
+		errorMessage := <-req.done
+		switch {
+		case results[i].Error != "":
+			rejected++
+		case errorMessage != "":
+			results[i].Status = http.StatusInternalServerError
+			results[i].Error = errorMessage
+			rejected++
+		default:
+			results[i].Status = http.StatusOK
+			accepted++
+		}
+	}
+
+	if accepted > 0 {
+		gateway.incrementWriteKeyStat("gateway.write_key_events", writeKey, accepted)
+		gateway.incrementWriteKeyStat("gateway.write_key_successful_requests", writeKey, 1)
+	}
+	if rejected > 0 {
+		gateway.incrementWriteKeyStat("gateway.write_key_failed_events", writeKey, rejected)
+		gateway.incrementWriteKeyStat("gateway.write_key_failed_requests", writeKey, 1)
+	}
+	if accepted > 0 && rejected > 0 {
+		gateway.incrementWriteKeyStat("gateway.batch_partial_success_requests", writeKey, 1)
+	}
+
+	statusCode := http.StatusOK
+	if accepted == 0 {
+		statusCode = http.StatusBadRequest
+	}
+
+	respBody, _ := json.Marshal(batchResponse{Results: results, Accepted: accepted, Rejected: rejected})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(respBody)
+}
+
+// withHandlerTimeout bounds a single web*Handler invocation to the configured
+// HandlerTimeout via http.TimeoutHandler, so a slow JobsDB write can't pin a
+// connection forever: past the deadline, the client gets a 503 RequestTimedOut
+// instead of hanging, while the handler keeps running in the background to
+// completion (its eventual write is simply discarded). It also increments
+// gateway.write_key_timeout_requests for the timed-out request's writeKey.
+func (gateway *HandleT) withHandlerTimeout(reqType string, handler func(string, http.ResponseWriter, *http.Request)) http.HandlerFunc {
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(reqType, w, r)
+	})
+	timeoutHandler := http.TimeoutHandler(inner, respondingTimeouts.HandlerTimeout, RequestTimedOut)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusCapturingWriter{ResponseWriter: w}
+		timeoutHandler.ServeHTTP(rec, r)
+		if rec.statusCode == http.StatusServiceUnavailable && rec.body.String() == RequestTimedOut {
+			writeKey, _, _ := r.BasicAuth()
+			gateway.incrementWriteKeyStat("gateway.write_key_timeout_requests", writeKey, 1)
+		}
+	}
+}
+
+// statusCapturingWriter records the status code and body written through it,
+// so withHandlerTimeout can tell http.TimeoutHandler's own 503 apart from any
+// other response the wrapped handler might produce.
+type statusCapturingWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (w *statusCapturingWriter) WriteHeader(code int) {
+	w.statusCode = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusCapturingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// Server returns an *http.Server for addr with this gateway's configured
+// RespondingTimeouts applied, so a slow or stalled client can't hold a
+// connection open indefinitely. HandlerTimeout is enforced separately, by
+// withHandlerTimeout wrapping each web*Handler.
+func (gateway *HandleT) Server(addr string) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		ReadTimeout:       respondingTimeouts.ReadTimeout,
+		ReadHeaderTimeout: respondingTimeouts.ReadHeaderTimeout,
+		WriteTimeout:      respondingTimeouts.WriteTimeout,
+		IdleTimeout:       respondingTimeouts.IdleTimeout,
+	}
+}
@@ -175,9 +175,6 @@ var _ = Describe("Gateway", func() {
 					DoAndReturn(func(jobs []*jobsdb.JobT) map[uuid.UUID]string {
 						for _, job := range jobs {
 							Expect(misc.IsValidUUID(job.UUID.String())).To(Equal(true))
-							Expect(job.Parameters).To(Equal(json.RawMessage(fmt.Sprintf(`{"source_id": "%v"}`, SourceIDEnabled))))
-							Expect(job.CustomVal).To(Equal(CustomVal))
-
 							responseData := []byte(job.EventPayload)
 							receivedAt := gjson.GetBytes(responseData, "receivedAt")
 							writeKey := gjson.GetBytes(responseData, "writeKey")
@@ -188,6 +185,16 @@ var _ = Describe("Gateway", func() {
 							anonymousID := payload.Get("anonymousId")
 							messageType := payload.Get("type")
 
+							// the messageId is persisted as a correlation ID alongside
+							// source_id so that the processor/router can later look up
+							// this specific message's sync-mode waiter, if any.
+							expectedParameters, _ := json.Marshal(struct {
+								SourceID  string `json:"source_id"`
+								MessageID string `json:"messageId"`
+							}{SourceID: SourceIDEnabled, MessageID: messageID.String()})
+							Expect(job.Parameters).To(Equal(json.RawMessage(expectedParameters)))
+							Expect(job.CustomVal).To(Equal(CustomVal))
+
 							strippedPayload, _ := sjson.Delete(payload.String(), "messageId")
 							strippedPayload, _ = sjson.Delete(strippedPayload, "anonymousId")
 							strippedPayload, _ = sjson.Delete(strippedPayload, "type")
@@ -226,6 +233,119 @@ var _ = Describe("Gateway", func() {
 		}
 	})
 
+	Context("Sync mode", func() {
+		var (
+			gateway      = &HandleT{}
+			clearDB bool = false
+		)
+
+		var previousSyncResponseTimeout time.Duration
+
+		BeforeEach(func() {
+			previousSyncResponseTimeout = syncResponseTimeout
+			SetSyncResponseTimeout(50 * time.Millisecond)
+			gateway.Setup(c.mockBackendConfig, c.mockJobsDB, nil, c.mockStats, &clearDB)
+		})
+
+		AfterEach(func() {
+			SetSyncResponseTimeout(previousSyncResponseTimeout)
+		})
+
+		// extracts the messageId the gateway assigned to the single event in
+		// validBody, from the payload handed to mockJobsDB.Store
+		expectStoreAndCapture := func(capturedMessageID *string) {
+			c.mockStatGatewayBatchSize.EXPECT().Count(1).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+			callStart := c.mockStatGatewayBatchTime.EXPECT().Start().Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+			c.mockStatGatewayBatchTime.EXPECT().End().After(callStart).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+
+			c.expectWriteKeyStat("gateway.write_key_requests", WriteKeyEnabled, 1)
+			c.expectWriteKeyStat("gateway.write_key_successful_requests", WriteKeyEnabled, 1)
+			c.expectWriteKeyStat("gateway.write_key_events", WriteKeyEnabled, 0)
+			c.expectWriteKeyStat("gateway.write_key_successful_events", WriteKeyEnabled, 0)
+
+			c.mockJobsDB.
+				EXPECT().Store(gomock.Any()).
+				DoAndReturn(func(jobs []*jobsdb.JobT) map[uuid.UUID]string {
+					messageID := gjson.GetBytes(jobs[0].EventPayload, "batch.0.messageId")
+					*capturedMessageID = messageID.String()
+					c.asyncHelper.ExpectAndNotifyCallback()()
+					return jobsToEmptyErrors(jobs)
+				}).
+				Times(1)
+		}
+
+		It("should block until the processor publishes a response, and propagate its status/body", func() {
+			var messageID string
+			expectStoreAndCapture(&messageID)
+
+			go func() {
+				// emulate the processor/router reaching a terminal outcome for
+				// this message, once it has been assigned a messageId
+				Eventually(func() string { return messageID }, time.Second).ShouldNot(BeEmpty())
+				gateway.PublishResponse(messageID, Response{StatusCode: 200, Body: "OK"})
+			}()
+
+			expectHandlerResponse(gateway.webTrackHandler, syncRequest(WriteKeyEnabled, bytes.NewBufferString(`{"data":"valid-json"}`)), 200, "OK")
+		})
+
+		It("should return 504 and unregister the waiter if no response arrives within the timeout", func() {
+			var messageID string
+			expectStoreAndCapture(&messageID)
+
+			expectHandlerResponse(gateway.webTrackHandler, syncRequest(WriteKeyEnabled, bytes.NewBufferString(`{"data":"valid-json"}`)), 504, RequestTimedOut+"\n")
+
+			// the waiter must have been unregistered, so a late publish is a no-op
+			Expect(gateway.PublishResponse(messageID, Response{StatusCode: 200, Body: "OK"})).To(BeFalse())
+		})
+
+		Context("multi-node deployment", func() {
+			BeforeEach(func() {
+				SetMultiNodeDeployment(true)
+			})
+
+			AfterEach(func() {
+				SetMultiNodeDeployment(false)
+			})
+
+			It("should reject ?wait=true up front instead of hanging out the timeout", func() {
+				// rejected before the request ever reaches webRequestQ, so no
+				// JobsDB.Store call or batch stat is expected
+				c.expectWriteKeyStat("gateway.write_key_requests", WriteKeyEnabled, 1)
+
+				expectHandlerResponse(gateway.webTrackHandler, syncRequest(WriteKeyEnabled, bytes.NewBufferString(`{"data":"valid-json"}`)), 501, SyncResponseUnsupportedMultiNode+"\n")
+			})
+		})
+
+		Context("max in-flight waiters", func() {
+			var previousMaxInFlightSyncWaiters int
+
+			BeforeEach(func() {
+				previousMaxInFlightSyncWaiters = maxInFlightSyncWaiters
+				SetMaxInFlightSyncWaiters(1)
+			})
+
+			AfterEach(func() {
+				SetMaxInFlightSyncWaiters(previousMaxInFlightSyncWaiters)
+			})
+
+			It("should return 503 MaxWaitersReached once the in-flight waiter limit is already occupied", func() {
+				// occupy the single allowed waiter slot directly, without going
+				// through a handler, so the limit is reached deterministically
+				go gateway.AwaitResponse("blocking-message-id", time.Hour)
+				Eventually(func() int {
+					gateway.waitersMu.Lock()
+					defer gateway.waitersMu.Unlock()
+					return len(gateway.waiters)
+				}, time.Second).Should(Equal(1))
+
+				var messageID string
+				expectStoreAndCapture(&messageID)
+
+				expectHandlerResponse(gateway.webTrackHandler, syncRequest(WriteKeyEnabled, bytes.NewBufferString(`{"data":"valid-json"}`)), 503, MaxWaitersReached+"\n")
+			})
+		})
+	})
+
 	Context("Rate limits", func() {
 		var (
 			gateway      = &HandleT{}
@@ -237,12 +357,14 @@ var _ = Describe("Gateway", func() {
 			gateway.Setup(c.mockBackendConfig, c.mockJobsDB, c.mockRateLimiter, c.mockStats, &clearDB)
 		})
 
-		It("should store messages successfuly if rate limit is not reached for workspace", func() {
+		It("should store messages successfuly if no layer's rate limit is reached", func() {
 			workspaceID := "some-workspace-id"
 
 			callStart := c.mockStatGatewayBatchTime.EXPECT().Start().Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
 			c.mockBackendConfig.EXPECT().GetWorkspaceIDForWriteKey(WriteKeyEnabled).Return(workspaceID).AnyTimes().Do(c.asyncHelper.ExpectAndNotifyCallback())
-			c.mockRateLimiter.EXPECT().LimitReached(workspaceID).Return(false).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+			c.mockRateLimiter.EXPECT().LimitReached("writeKey:" + WriteKeyEnabled).Return(false).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+			c.mockRateLimiter.EXPECT().LimitReached("source:" + SourceIDEnabled).Return(false).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+			c.mockRateLimiter.EXPECT().LimitReached("workspace:" + workspaceID).Return(false).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
 			callStore := c.mockJobsDB.EXPECT().Store(gomock.Any()).DoAndReturn(jobsToEmptyErrors).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
 			callEnd := c.mockStatGatewayBatchTime.EXPECT().End().After(callStart).After(callStore).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
 			c.mockStatGatewayBatchSize.EXPECT().Count(1).After(callEnd).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
@@ -255,13 +377,57 @@ var _ = Describe("Gateway", func() {
 			expectHandlerResponse(gateway.webAliasHandler, authorizedRequest(WriteKeyEnabled, bytes.NewBufferString("{}")), 200, "OK")
 		})
 
-		It("should reject messages if rate limit is reached for workspace", func() {
+		It("should reject, with Retry-After, as soon as the writeKey limit trips, without consulting the workspace layer", func() {
 			workspaceID := "some-workspace-id"
 			var emptyJobsList []*jobsdb.JobT
 
 			callStart := c.mockStatGatewayBatchTime.EXPECT().Start().Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
 			c.mockBackendConfig.EXPECT().GetWorkspaceIDForWriteKey(WriteKeyEnabled).Return(workspaceID).AnyTimes().Do(c.asyncHelper.ExpectAndNotifyCallback())
-			c.mockRateLimiter.EXPECT().LimitReached(workspaceID).Return(true).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+			c.mockRateLimiter.EXPECT().LimitReached("writeKey:" + WriteKeyEnabled).Return(true).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+			c.mockRateLimiter.EXPECT().RetryAfter("writeKey:" + WriteKeyEnabled).Return(3 * time.Second).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+			callStore := c.mockJobsDB.EXPECT().Store(emptyJobsList).DoAndReturn(jobsToEmptyErrors).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+			callEnd := c.mockStatGatewayBatchTime.EXPECT().End().After(callStart).After(callStore).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+			c.mockStatGatewayBatchSize.EXPECT().Count(1).After(callEnd).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+
+			c.expectWriteKeyStat("gateway.write_key_requests", WriteKeyEnabled, 1)
+			c.expectWriteKeyStat("gateway.write_key_dropped_requests", WriteKeyEnabled, 1)
+
+			rr := doRequest(gateway.webAliasHandler, authorizedRequest(WriteKeyEnabled, bytes.NewBufferString("{}")))
+			Expect(rr.Code).To(Equal(429))
+			Expect(rr.Header().Get("Retry-After")).To(Equal("3"))
+		})
+
+		It("should reject, with the source stat, once the source limit trips after the writeKey layer passes", func() {
+			workspaceID := "some-workspace-id"
+			var emptyJobsList []*jobsdb.JobT
+
+			callStart := c.mockStatGatewayBatchTime.EXPECT().Start().Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+			c.mockBackendConfig.EXPECT().GetWorkspaceIDForWriteKey(WriteKeyEnabled).Return(workspaceID).AnyTimes().Do(c.asyncHelper.ExpectAndNotifyCallback())
+			c.mockRateLimiter.EXPECT().LimitReached("writeKey:" + WriteKeyEnabled).Return(false).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+			c.mockRateLimiter.EXPECT().LimitReached("source:" + SourceIDEnabled).Return(true).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+			c.mockRateLimiter.EXPECT().RetryAfter("source:" + SourceIDEnabled).Return(2 * time.Second).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+			callStore := c.mockJobsDB.EXPECT().Store(emptyJobsList).DoAndReturn(jobsToEmptyErrors).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+			callEnd := c.mockStatGatewayBatchTime.EXPECT().End().After(callStart).After(callStore).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+			c.mockStatGatewayBatchSize.EXPECT().Count(1).After(callEnd).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+
+			c.expectWriteKeyStat("gateway.write_key_requests", WriteKeyEnabled, 1)
+			c.expectWriteKeyStat("gateway.source_dropped_requests", SourceIDEnabled, 1)
+
+			rr := doRequest(gateway.webAliasHandler, authorizedRequest(WriteKeyEnabled, bytes.NewBufferString("{}")))
+			Expect(rr.Code).To(Equal(429))
+			Expect(rr.Header().Get("Retry-After")).To(Equal("2"))
+		})
+
+		It("should reject messages if the workspace layer is reached, after writeKey and source layers pass", func() {
+			workspaceID := "some-workspace-id"
+			var emptyJobsList []*jobsdb.JobT
+
+			callStart := c.mockStatGatewayBatchTime.EXPECT().Start().Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+			c.mockBackendConfig.EXPECT().GetWorkspaceIDForWriteKey(WriteKeyEnabled).Return(workspaceID).AnyTimes().Do(c.asyncHelper.ExpectAndNotifyCallback())
+			c.mockRateLimiter.EXPECT().LimitReached("writeKey:" + WriteKeyEnabled).Return(false).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+			c.mockRateLimiter.EXPECT().LimitReached("source:" + SourceIDEnabled).Return(false).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+			c.mockRateLimiter.EXPECT().LimitReached("workspace:" + workspaceID).Return(true).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+			c.mockRateLimiter.EXPECT().RetryAfter("workspace:" + workspaceID).Return(time.Second).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
 			callStore := c.mockJobsDB.EXPECT().Store(emptyJobsList).DoAndReturn(jobsToEmptyErrors).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
 			callEnd := c.mockStatGatewayBatchTime.EXPECT().End().After(callStart).After(callStore).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
 			c.mockStatGatewayBatchSize.EXPECT().Count(1).After(callEnd).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
@@ -269,7 +435,165 @@ var _ = Describe("Gateway", func() {
 			c.expectWriteKeyStat("gateway.write_key_requests", WriteKeyEnabled, 1)
 			c.expectWriteKeyStat("gateway.work_space_dropped_requests", workspaceID, 1)
 
-			expectHandlerResponse(gateway.webAliasHandler, authorizedRequest(WriteKeyEnabled, bytes.NewBufferString("{}")), 400, TooManyRequests+"\n")
+			expectHandlerResponse(gateway.webAliasHandler, authorizedRequest(WriteKeyEnabled, bytes.NewBufferString("{}")), 429, TooManyRequests+"\n")
+		})
+	})
+
+	Context("Handler timeout", func() {
+		var (
+			gateway      = &HandleT{}
+			clearDB bool = false
+		)
+
+		var previousHandlerTimeout time.Duration
+
+		BeforeEach(func() {
+			previousHandlerTimeout = respondingTimeouts.HandlerTimeout
+			SetHandlerTimeout(20 * time.Millisecond)
+			gateway.Setup(c.mockBackendConfig, c.mockJobsDB, nil, c.mockStats, &clearDB)
+		})
+
+		AfterEach(func() {
+			SetHandlerTimeout(previousHandlerTimeout)
+		})
+
+		It("should return 503 and increment the timeout stat if JobsDB.Store outlives HandlerTimeout", func() {
+			validBody := `{"data":"valid-json"}`
+
+			c.mockStatGatewayBatchSize.EXPECT().Count(1).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+			callStart := c.mockStatGatewayBatchTime.EXPECT().Start().Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+			c.mockStatGatewayBatchTime.EXPECT().End().After(callStart).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+
+			c.expectWriteKeyStat("gateway.write_key_requests", WriteKeyEnabled, 1)
+			c.expectWriteKeyStat("gateway.write_key_timeout_requests", WriteKeyEnabled, 1)
+			c.expectWriteKeyStat("gateway.write_key_successful_requests", WriteKeyEnabled, 1)
+			c.expectWriteKeyStat("gateway.write_key_events", WriteKeyEnabled, 0)
+			c.expectWriteKeyStat("gateway.write_key_successful_events", WriteKeyEnabled, 0)
+
+			// the job is still durably stored once Store finally returns; it's
+			// the client that gives up waiting, not the write itself
+			c.mockJobsDB.
+				EXPECT().Store(gomock.Any()).
+				DoAndReturn(func(jobs []*jobsdb.JobT) map[uuid.UUID]string {
+					time.Sleep(100 * time.Millisecond)
+					c.asyncHelper.ExpectAndNotifyCallback()()
+					return jobsToEmptyErrors(jobs)
+				}).
+				Times(1)
+
+			expectHandlerResponse(gateway.webTrackHandler, authorizedRequest(WriteKeyEnabled, bytes.NewBufferString(validBody)), 503, RequestTimedOut)
+		})
+	})
+
+	Context("Batch requests", func() {
+		var (
+			gateway      = &HandleT{}
+			clearDB bool = false
+		)
+
+		BeforeEach(func() {
+			gateway.Setup(c.mockBackendConfig, c.mockJobsDB, nil, c.mockStats, &clearDB)
+		})
+
+		doBatchRequest := func(body string) *httptest.ResponseRecorder {
+			return doRequest(gateway.webBatchHandler, authorizedRequest(WriteKeyEnabled, bytes.NewBufferString(body)))
+		}
+
+		It("should store every message and report 200 when the whole batch is valid", func() {
+			body := `{"batch":[{"type":"track","event":"e1"},{"type":"page","name":"p1"}]}`
+
+			c.mockStatGatewayBatchSize.EXPECT().Count(2).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+			callStart := c.mockStatGatewayBatchTime.EXPECT().Start().Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+
+			c.expectWriteKeyStat("gateway.write_key_requests", WriteKeyEnabled, 1)
+			c.expectWriteKeyStat("gateway.write_key_successful_requests", WriteKeyEnabled, 1)
+			c.expectWriteKeyStat("gateway.write_key_events", WriteKeyEnabled, 2)
+
+			callStore := c.mockJobsDB.
+				EXPECT().Store(gomock.Any()).
+				DoAndReturn(func(jobs []*jobsdb.JobT) map[uuid.UUID]string {
+					Expect(jobs).To(HaveLen(2))
+					c.asyncHelper.ExpectAndNotifyCallback()()
+					return jobsToEmptyErrors(jobs)
+				}).
+				Times(1)
+			c.mockStatGatewayBatchTime.EXPECT().End().After(callStart).After(callStore).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+
+			rr := doBatchRequest(body)
+			Expect(rr.Code).To(Equal(200))
+
+			var resp batchResponse
+			Expect(json.Unmarshal(rr.Body.Bytes(), &resp)).To(Succeed())
+			Expect(resp.Accepted).To(Equal(2))
+			Expect(resp.Rejected).To(Equal(0))
+			Expect(resp.Results).To(HaveLen(2))
+			for _, result := range resp.Results {
+				Expect(result.Status).To(Equal(200))
+				Expect(result.MessageID).NotTo(BeEmpty())
+			}
+		})
+
+		It("should reject every message and report 400 when the whole batch is invalid", func() {
+			body := `{"batch":["not-an-object", 42]}`
+
+			c.mockStatGatewayBatchSize.EXPECT().Count(2).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+			callStart := c.mockStatGatewayBatchTime.EXPECT().Start().Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+
+			var emptyJobsList []*jobsdb.JobT
+			callStore := c.mockJobsDB.EXPECT().Store(emptyJobsList).DoAndReturn(jobsToEmptyErrors).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+			c.mockStatGatewayBatchTime.EXPECT().End().After(callStart).After(callStore).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+
+			c.expectWriteKeyStat("gateway.write_key_requests", WriteKeyEnabled, 1)
+			c.expectWriteKeyStat("gateway.write_key_failed_requests", WriteKeyEnabled, 1)
+			c.expectWriteKeyStat("gateway.write_key_failed_events", WriteKeyEnabled, 2)
+
+			rr := doBatchRequest(body)
+			Expect(rr.Code).To(Equal(400))
+
+			var resp batchResponse
+			Expect(json.Unmarshal(rr.Body.Bytes(), &resp)).To(Succeed())
+			Expect(resp.Accepted).To(Equal(0))
+			Expect(resp.Rejected).To(Equal(2))
+			for _, result := range resp.Results {
+				Expect(result.Status).To(Equal(400))
+				Expect(result.Error).To(Equal(InvalidJSON))
+			}
+		})
+
+		It("should store the valid messages, reject the invalid ones, and report 200 with a partial-success stat", func() {
+			body := `{"batch":[{"type":"track","event":"e1"},"not-an-object"]}`
+
+			c.mockStatGatewayBatchSize.EXPECT().Count(2).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+			callStart := c.mockStatGatewayBatchTime.EXPECT().Start().Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+
+			c.expectWriteKeyStat("gateway.write_key_requests", WriteKeyEnabled, 1)
+			c.expectWriteKeyStat("gateway.write_key_successful_requests", WriteKeyEnabled, 1)
+			c.expectWriteKeyStat("gateway.write_key_failed_requests", WriteKeyEnabled, 1)
+			c.expectWriteKeyStat("gateway.write_key_events", WriteKeyEnabled, 1)
+			c.expectWriteKeyStat("gateway.write_key_failed_events", WriteKeyEnabled, 1)
+			c.expectWriteKeyStat("gateway.batch_partial_success_requests", WriteKeyEnabled, 1)
+
+			callStore := c.mockJobsDB.
+				EXPECT().Store(gomock.Any()).
+				DoAndReturn(func(jobs []*jobsdb.JobT) map[uuid.UUID]string {
+					Expect(jobs).To(HaveLen(1))
+					Expect(gjson.GetBytes(jobs[0].EventPayload, "batch.0.type").String()).To(Equal("track"))
+					c.asyncHelper.ExpectAndNotifyCallback()()
+					return jobsToEmptyErrors(jobs)
+				}).
+				Times(1)
+			c.mockStatGatewayBatchTime.EXPECT().End().After(callStart).After(callStore).Times(1).Do(c.asyncHelper.ExpectAndNotifyCallback())
+
+			rr := doBatchRequest(body)
+			Expect(rr.Code).To(Equal(200))
+
+			var resp batchResponse
+			Expect(json.Unmarshal(rr.Body.Bytes(), &resp)).To(Succeed())
+			Expect(resp.Accepted).To(Equal(1))
+			Expect(resp.Rejected).To(Equal(1))
+			Expect(resp.Results[0].Status).To(Equal(200))
+			Expect(resp.Results[1].Status).To(Equal(400))
+			Expect(resp.Results[1].Error).To(Equal(InvalidJSON))
 		})
 	})
 
@@ -411,6 +735,24 @@ func authorizedRequest(username string, body io.Reader) *http.Request {
 	return req
 }
 
+// syncRequest builds an authorized request that opts into synchronous
+// (?wait=true) delivery.
+func syncRequest(writeKey string, body io.Reader) *http.Request {
+	req := authorizedRequest(writeKey, body)
+	req.URL.RawQuery = "wait=true"
+	return req
+}
+
+// doRequest runs handler against req and returns the recorder, so callers can
+// assert on response headers in addition to status/body.
+func doRequest(handler http.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	testutils.RunTestWithTimeout(func() {
+		handler.ServeHTTP(rr, req)
+	}, time.Minute)
+	return rr
+}
+
 func expectHandlerResponse(handler http.HandlerFunc, req *http.Request, responseStatus int, responseBody string) {
 	testutils.RunTestWithTimeout(func() {
 		rr := httptest.NewRecorder()
@@ -442,4 +784,4 @@ func jobsToEmptyErrors(jobs []*jobsdb.JobT) map[uuid.UUID]string {
 		result[job.UUID] = ""
 	}
 	return result
-}
\ No newline at end of file
+}